@@ -1,15 +1,18 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"jobqueue/db"
 	"jobqueue/handlers"
+	"jobqueue/models"
 	"jobqueue/services"
 )
 
@@ -28,21 +31,45 @@ func main() {
 	}
 	defer mongoClient.Disconnect(nil)
 
-	// Get jobs collection
+	// Get jobs, scheduled-jobs and job-logs collections
 	jobsCol := db.GetJobsCollection(mongoClient)
+	scheduledCol := db.GetScheduledJobsCollection(mongoClient)
+	logsCol := db.GetJobLogsCollection(mongoClient)
 
-	// Create job worker with buffered channel (capacity 100) and 2 worker goroutines
-	// The channel acts as the in-memory queue for job IDs
-	jobWorker := services.NewJobWorker(jobsCol, 100, 2)
+	// Create the indexes the claim loop and log queries rely on
+	if err := db.EnsureJobIndexes(context.Background(), jobsCol); err != nil {
+		log.Fatalf("Failed to ensure job indexes: %v", err)
+	}
+	if err := db.EnsureJobLogIndexes(context.Background(), logsCol); err != nil {
+		log.Fatalf("Failed to ensure job log indexes: %v", err)
+	}
+
+	// Create job worker with 2 worker goroutines that claim jobs directly
+	// from MongoDB; queueSize only sizes the internal wake-up hint channel
+	jobWorker := services.NewJobWorker(jobsCol, logsCol, 100, 2)
+
+	// Register the job types this worker instance knows how to run. Real
+	// deployments would split these across dedicated binaries/packages, but
+	// registering them here keeps the example self-contained.
+	registerJobHandlers(jobWorker)
 
 	// Start worker goroutines to process jobs asynchronously
 	jobWorker.Start()
 
+	// Start the scheduler that dispatches delayed jobs once they're due and
+	// fires recurring cron specs
+	scheduler := services.NewScheduler(jobsCol, scheduledCol, jobWorker, 2*time.Second)
+	scheduler.Start()
+
 	// Create job handler
-	jobHandler := handlers.NewJobHandler(jobsCol, jobWorker)
+	jobHandler := handlers.NewJobHandler(jobsCol, scheduledCol, logsCol, jobWorker)
 
 	// Register HTTP routes
 	http.HandleFunc("/jobs", handleJobsRoute(jobHandler))
+	http.HandleFunc("/jobs/schedule", jobHandler.ScheduleJob)
+	http.HandleFunc("/jobs/logs", jobHandler.GetJobLogs)
+	http.HandleFunc("/jobs/graph", handleJobGraphRoute(jobHandler))
+	http.HandleFunc("/v2/job-types", jobHandler.ListJobTypes)
 	http.HandleFunc("/health", handleHealth)
 
 	// Start HTTP server
@@ -71,7 +98,8 @@ func main() {
 
 	log.Println("Shutdown signal received")
 
-	// Stop the job worker
+	// Stop the scheduler and the job worker
+	scheduler.Stop()
 	jobWorker.Stop()
 
 	// Shutdown the HTTP server
@@ -82,6 +110,19 @@ func main() {
 	log.Println("Server stopped")
 }
 
+// registerJobHandlers wires up the job types this worker accepts. Each type
+// gets its own timeout so a slow handler for one type can't stall others.
+func registerJobHandlers(worker *services.JobWorker) {
+	worker.Register("email.send", func(ctx context.Context, payload map[string]interface{}, logger *services.JobLogger) error {
+		logger.Logf(models.LogLevelInfo, "sending email with payload: %v", payload)
+		return nil
+	}, services.HandlerConfig{Timeout: 10 * time.Second, MaxRetries: 3})
+
+	worker.Register("noop", func(ctx context.Context, payload map[string]interface{}, logger *services.JobLogger) error {
+		return nil
+	}, services.HandlerConfig{Timeout: 5 * time.Second, MaxRetries: 1})
+}
+
 // handleJobsRoute routes requests based on the HTTP method and query parameters
 func handleJobsRoute(handler *handlers.JobHandler) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -110,6 +151,20 @@ func handleJobsRoute(handler *handlers.JobHandler) http.HandlerFunc {
 	}
 }
 
+// handleJobGraphRoute routes requests based on the HTTP method
+func handleJobGraphRoute(handler *handlers.JobHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost:
+			handler.CreateJobGraph(w, r)
+		case http.MethodGet:
+			handler.GetJobGraph(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
 // handleHealth is a simple health check endpoint
 func handleHealth(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
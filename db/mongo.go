@@ -6,6 +6,7 @@ import (
 	"log"
 	"time"
 
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
@@ -43,3 +44,60 @@ func DisconnectMongoDB(client *mongo.Client) error {
 func GetJobsCollection(client *mongo.Client) *mongo.Collection {
 	return client.Database("jobqueue").Collection("jobs")
 }
+
+// GetScheduledJobsCollection returns the collection holding recurring cron
+// job specs.
+func GetScheduledJobsCollection(client *mongo.Client) *mongo.Collection {
+	return client.Database("jobqueue").Collection("scheduled_jobs")
+}
+
+// GetJobLogsCollection returns the collection holding structured log lines
+// emitted by handlers while a job runs.
+func GetJobLogsCollection(client *mongo.Client) *mongo.Collection {
+	return client.Database("jobqueue").Collection("job_logs")
+}
+
+// EnsureJobIndexes creates the indexes the claim-based dispatch loop relies
+// on. It's idempotent, so it's safe to call on every startup.
+func EnsureJobIndexes(ctx context.Context, jobsCol *mongo.Collection) error {
+	_, err := jobsCol.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{
+			{Key: "status", Value: 1},
+			{Key: "lockedUntil", Value: 1},
+			{Key: "createdAt", Value: 1},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create job claim index: %w", err)
+	}
+
+	// Matches the claim query's sort (priority desc, createdAt asc) so
+	// FindOneAndUpdate can use an index scan instead of sorting every
+	// eligible pending job in memory.
+	_, err = jobsCol.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{
+			{Key: "status", Value: 1},
+			{Key: "priority", Value: -1},
+			{Key: "createdAt", Value: 1},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create job priority claim index: %w", err)
+	}
+	return nil
+}
+
+// EnsureJobLogIndexes creates the index job log queries (by job, in seq
+// order) rely on. It's idempotent, so it's safe to call on every startup.
+func EnsureJobLogIndexes(ctx context.Context, jobLogsCol *mongo.Collection) error {
+	_, err := jobLogsCol.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{
+			{Key: "jobID", Value: 1},
+			{Key: "seq", Value: 1},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create job log index: %w", err)
+	}
+	return nil
+}
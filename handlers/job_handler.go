@@ -3,8 +3,12 @@ package handlers
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
@@ -15,17 +19,25 @@ import (
 	"jobqueue/services"
 )
 
+// jobLogFollowPollInterval controls how often GET /jobs/logs?follow=1
+// re-checks Mongo for new log lines.
+const jobLogFollowPollInterval = 500 * time.Millisecond
+
 // JobHandler handles HTTP requests for job operations
 type JobHandler struct {
-	jobsCol *mongo.Collection
-	worker  *services.JobWorker
+	jobsCol      *mongo.Collection
+	scheduledCol *mongo.Collection
+	logsCol      *mongo.Collection
+	worker       *services.JobWorker
 }
 
 // NewJobHandler creates a new job handler
-func NewJobHandler(jobsCollection *mongo.Collection, jobWorker *services.JobWorker) *JobHandler {
+func NewJobHandler(jobsCollection, scheduledCollection, logsCollection *mongo.Collection, jobWorker *services.JobWorker) *JobHandler {
 	return &JobHandler{
-		jobsCol: jobsCollection,
-		worker:  jobWorker,
+		jobsCol:      jobsCollection,
+		scheduledCol: scheduledCollection,
+		logsCol:      logsCollection,
+		worker:       jobWorker,
 	}
 }
 
@@ -33,6 +45,21 @@ func NewJobHandler(jobsCollection *mongo.Collection, jobWorker *services.JobWork
 type CreateJobRequest struct {
 	Type    string `json:"type"`
 	Payload map[string]interface{} `json:"payload"`
+	// RunAt delays the job until a specific time. DelaySeconds is a
+	// shorthand for "RunAt = now + N seconds"; if both are set, RunAt wins.
+	RunAt        *time.Time `json:"runAt,omitempty"`
+	DelaySeconds int        `json:"delaySeconds,omitempty"`
+	// Priority controls claim order: higher values are claimed first.
+	// Defaults to 0.
+	Priority int `json:"priority,omitempty"`
+}
+
+// ScheduleJobRequest represents the request body for creating a recurring
+// cron job spec.
+type ScheduleJobRequest struct {
+	CronExpr string                 `json:"cronExpr"`
+	Type     string                 `json:"type"`
+	Payload  map[string]interface{} `json:"payload"`
 }
 
 // CreateJob handles POST /jobs - creates a new job and enqueues it
@@ -54,15 +81,29 @@ func (jh *JobHandler) CreateJob(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !jh.worker.IsRegistered(req.Type) {
+		http.Error(w, fmt.Sprintf("Unknown job type %q", req.Type), http.StatusBadRequest)
+		return
+	}
+
+	// Resolve the optional delay into a concrete runAt
+	runAt := req.RunAt
+	if runAt == nil && req.DelaySeconds > 0 {
+		t := time.Now().Add(time.Duration(req.DelaySeconds) * time.Second)
+		runAt = &t
+	}
+
 	// Create job document
 	job := models.Job{
-		ID:        primitive.NewObjectID(),
-		Type:      req.Type,
-		Payload:   req.Payload,
-		Status:    models.StatusPending,
+		ID:         primitive.NewObjectID(),
+		Type:       req.Type,
+		Payload:    req.Payload,
+		Status:     models.StatusPending,
 		RetryCount: 0,
-		CreatedAt: time.Now(),
-		UpdatedAt: time.Now(),
+		Priority:   req.Priority,
+		RunAt:      runAt,
+		CreatedAt:  time.Now(),
+		UpdatedAt:  time.Now(),
 	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
@@ -76,17 +117,75 @@ func (jh *JobHandler) CreateJob(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Enqueue the job for processing
-	jobID := result.InsertedID.(primitive.ObjectID)
-	jh.worker.EnqueueJob(jobID)
-
 	// Return the created job
+	jobID := result.InsertedID.(primitive.ObjectID)
 	job.ID = jobID
+
+	// Enqueue immediately unless it's delayed; the scheduler will pick up
+	// delayed jobs once runAt elapses.
+	if runAt == nil || !runAt.After(time.Now()) {
+		jh.worker.EnqueueJob(jobID)
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(job)
 }
 
+// ScheduleJob handles POST /jobs/schedule - registers a recurring cron job
+// spec. The scheduler inserts a new Job each time the cron expression fires.
+func (jh *JobHandler) ScheduleJob(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req ScheduleJobRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.CronExpr == "" || req.Type == "" || len(req.Payload) == 0 {
+		http.Error(w, "cronExpr, type and payload are required", http.StatusBadRequest)
+		return
+	}
+
+	if !jh.worker.IsRegistered(req.Type) {
+		http.Error(w, fmt.Sprintf("Unknown job type %q", req.Type), http.StatusBadRequest)
+		return
+	}
+
+	nextRun, err := services.NextCronRun(req.CronExpr, time.Now())
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid cron expression: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	spec := models.ScheduledJob{
+		ID:        primitive.NewObjectID(),
+		CronExpr:  req.CronExpr,
+		Type:      req.Type,
+		Payload:   req.Payload,
+		NextRun:   nextRun,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := jh.scheduledCol.InsertOne(ctx, spec); err != nil {
+		log.Printf("Failed to insert scheduled job: %v\n", err)
+		http.Error(w, "Failed to create scheduled job", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(spec)
+}
+
 // GetJob handles GET /jobs/{id} - retrieves a job by ID
 func (jh *JobHandler) GetJob(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
@@ -128,7 +227,8 @@ func (jh *JobHandler) GetJob(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(job)
 }
 
-// ListJobs handles GET /jobs - lists all jobs (limit 50)
+// ListJobs handles GET /jobs - lists jobs (limit 50), optionally filtered by
+// ?status= and/or ?type= so operators can inspect the backlog per class.
 func (jh *JobHandler) ListJobs(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -138,9 +238,17 @@ func (jh *JobHandler) ListJobs(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
+	filter := bson.M{}
+	if status := r.URL.Query().Get("status"); status != "" {
+		filter["status"] = status
+	}
+	if jobType := r.URL.Query().Get("type"); jobType != "" {
+		filter["type"] = jobType
+	}
+
 	// Query jobs with limit of 50, sorted by creation date descending
 	opts := options.Find().SetLimit(50).SetSort(bson.M{"createdAt": -1})
-	cursor, err := jh.jobsCol.Find(ctx, bson.M{}, opts)
+	cursor, err := jh.jobsCol.Find(ctx, filter, opts)
 	if err != nil {
 		log.Printf("Failed to query jobs: %v\n", err)
 		http.Error(w, "Failed to retrieve jobs", http.StatusInternalServerError)
@@ -158,3 +266,368 @@ func (jh *JobHandler) ListJobs(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(jobs)
 }
+
+// ListJobTypes handles GET /v2/job-types - lists the job types the worker
+// currently accepts, along with their configured limits, so operators can
+// check what will be rejected before enqueueing.
+func (jh *JobHandler) ListJobTypes(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(jh.worker.JobTypes())
+}
+
+// GetJobLogs handles GET /jobs/logs?id=<id>&after=<seq>&follow=1 - returns
+// log lines a handler recorded for a job. With follow=1 it stays open and
+// streams newly written lines as newline-delimited JSON until the client
+// disconnects.
+func (jh *JobHandler) GetJobLogs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	jobIDStr := r.URL.Query().Get("id")
+	if jobIDStr == "" {
+		http.Error(w, "Job ID is required", http.StatusBadRequest)
+		return
+	}
+	jobID, err := primitive.ObjectIDFromHex(jobIDStr)
+	if err != nil {
+		http.Error(w, "Invalid job ID format", http.StatusBadRequest)
+		return
+	}
+
+	after, err := strconv.ParseInt(r.URL.Query().Get("after"), 10, 64)
+	if err != nil {
+		after = 0
+	}
+	follow := r.URL.Query().Get("follow") == "1"
+
+	if !follow {
+		logs, err := jh.fetchLogsAfter(jobID, after)
+		if err != nil {
+			log.Printf("Failed to query job logs: %v\n", err)
+			http.Error(w, "Failed to retrieve job logs", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(logs)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	ticker := time.NewTicker(jobLogFollowPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+			logs, err := jh.fetchLogsAfter(jobID, after)
+			if err != nil {
+				log.Printf("Failed to poll job logs for %s: %v\n", jobID.Hex(), err)
+				continue
+			}
+			for _, entry := range logs {
+				if err := json.NewEncoder(w).Encode(entry); err != nil {
+					return
+				}
+				after = entry.Seq
+			}
+			if len(logs) > 0 {
+				flusher.Flush()
+			}
+		}
+	}
+}
+
+func (jh *JobHandler) fetchLogsAfter(jobID primitive.ObjectID, after int64) ([]models.JobLog, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.M{"seq": 1})
+	cursor, err := jh.logsCol.Find(ctx, bson.M{"jobID": jobID, "seq": bson.M{"$gt": after}}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	logs := []models.JobLog{}
+	if err := cursor.All(ctx, &logs); err != nil {
+		return nil, err
+	}
+	return logs, nil
+}
+
+// GraphNode describes one job to insert as part of a POST /jobs/graph
+// request; edges reference nodes by their index in this slice.
+type GraphNode struct {
+	Type    string                 `json:"type"`
+	Payload map[string]interface{} `json:"payload"`
+}
+
+// GraphEdge wires node From as a parent of node To (both node indices).
+type GraphEdge struct {
+	From int `json:"from"`
+	To   int `json:"to"`
+}
+
+// CreateJobGraphRequest represents the request body for POST /jobs/graph.
+type CreateJobGraphRequest struct {
+	Nodes []GraphNode `json:"nodes"`
+	Edges []GraphEdge `json:"edges"`
+}
+
+// transactionsUnsupportedCode is the MongoDB server error code
+// ("IllegalOperation") returned when a transaction is started against a
+// deployment that doesn't support them, e.g. a standalone instance.
+const transactionsUnsupportedCode = 20
+
+// isTransactionsUnsupported reports whether err is the MongoDB server
+// rejecting a transaction because the deployment isn't a replica set or
+// mongos. The driver can surface this either as a mongo.CommandError or
+// wrapped inside a bulk write exception, so fall back to a substring check
+// on the well-known server message if the type assertion doesn't match.
+func isTransactionsUnsupported(err error) bool {
+	if err == nil {
+		return false
+	}
+	var cmdErr mongo.CommandError
+	if errors.As(err, &cmdErr) {
+		return cmdErr.Code == transactionsUnsupportedCode
+	}
+	return strings.Contains(err.Error(), "Transaction numbers are only allowed")
+}
+
+// findGraphCycle walks the node graph (given as an adjacency list of child
+// indices) looking for a cycle via DFS with a recursion stack. It returns
+// the cycle as a slice of node indices, or nil if the graph is a DAG. A
+// cyclic graph would leave every node in the cycle StatusBlocked forever,
+// since none of them would ever have all parents complete.
+func findGraphCycle(children [][]int) []int {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make([]int, len(children))
+	var stack []int
+
+	var visit func(n int) []int
+	visit = func(n int) []int {
+		state[n] = visiting
+		stack = append(stack, n)
+		for _, next := range children[n] {
+			switch state[next] {
+			case visiting:
+				start := 0
+				for i, node := range stack {
+					if node == next {
+						start = i
+						break
+					}
+				}
+				return append(append([]int{}, stack[start:]...), next)
+			case unvisited:
+				if cycle := visit(next); cycle != nil {
+					return cycle
+				}
+			}
+		}
+		stack = stack[:len(stack)-1]
+		state[n] = visited
+		return nil
+	}
+
+	for n := range children {
+		if state[n] == unvisited {
+			if cycle := visit(n); cycle != nil {
+				return cycle
+			}
+		}
+	}
+	return nil
+}
+
+// CreateJobGraph handles POST /jobs/graph - inserts a DAG of jobs in one
+// transaction and enqueues the roots (nodes with no parents). Dependent nodes
+// start StatusBlocked and are unblocked by the worker as their parents
+// complete. On a deployment without transaction support (a standalone
+// MongoDB) the nodes are inserted without a transaction, so the insert is not
+// atomic there and a failure can leave a partial graph.
+func (jh *JobHandler) CreateJobGraph(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req CreateJobGraphRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if len(req.Nodes) == 0 {
+		http.Error(w, "At least one node is required", http.StatusBadRequest)
+		return
+	}
+
+	jobs := make([]models.Job, len(req.Nodes))
+	now := time.Now()
+	for i, node := range req.Nodes {
+		if node.Type == "" || len(node.Payload) == 0 {
+			http.Error(w, fmt.Sprintf("Node %d: type and payload are required", i), http.StatusBadRequest)
+			return
+		}
+		if !jh.worker.IsRegistered(node.Type) {
+			http.Error(w, fmt.Sprintf("Node %d: unknown job type %q", i, node.Type), http.StatusBadRequest)
+			return
+		}
+		jobs[i] = models.Job{
+			ID:        primitive.NewObjectID(),
+			Type:      node.Type,
+			Payload:   node.Payload,
+			Status:    models.StatusPending,
+			CreatedAt: now,
+			UpdatedAt: now,
+		}
+	}
+
+	children := make([][]int, len(jobs))
+	for _, edge := range req.Edges {
+		if edge.From < 0 || edge.From >= len(jobs) || edge.To < 0 || edge.To >= len(jobs) {
+			http.Error(w, fmt.Sprintf("Edge references an out-of-range node: %+v", edge), http.StatusBadRequest)
+			return
+		}
+		jobs[edge.From].ChildIDs = append(jobs[edge.From].ChildIDs, jobs[edge.To].ID)
+		jobs[edge.To].ParentIDs = append(jobs[edge.To].ParentIDs, jobs[edge.From].ID)
+		children[edge.From] = append(children[edge.From], edge.To)
+	}
+
+	if cycle := findGraphCycle(children); cycle != nil {
+		http.Error(w, fmt.Sprintf("Graph contains a cycle: %v", cycle), http.StatusBadRequest)
+		return
+	}
+
+	// A node with parents can't run until they complete.
+	for i := range jobs {
+		if len(jobs[i].ParentIDs) > 0 {
+			jobs[i].Status = models.StatusBlocked
+		}
+	}
+
+	docs := make([]interface{}, len(jobs))
+	for i, job := range jobs {
+		docs[i] = job
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	session, err := jh.jobsCol.Database().Client().StartSession()
+	if err != nil {
+		log.Printf("Failed to start session for job graph: %v\n", err)
+		http.Error(w, "Failed to create job graph", http.StatusInternalServerError)
+		return
+	}
+	defer session.EndSession(ctx)
+
+	_, err = session.WithTransaction(ctx, func(sessCtx mongo.SessionContext) (interface{}, error) {
+		return jh.jobsCol.InsertMany(sessCtx, docs)
+	})
+	if isTransactionsUnsupported(err) {
+		// The default deployment (mongodb://localhost:27017) is a standalone
+		// instance, which doesn't support multi-document transactions. The
+		// nodes in a graph are independent documents, so a non-atomic
+		// InsertMany is an acceptable fallback: the worst case is a partial
+		// graph rather than a torn single document.
+		log.Println("Transactions unsupported (standalone MongoDB), falling back to non-atomic insert for job graph")
+		_, err = jh.jobsCol.InsertMany(ctx, docs)
+	}
+	if err != nil {
+		log.Printf("Failed to insert job graph: %v\n", err)
+		http.Error(w, "Failed to create job graph", http.StatusInternalServerError)
+		return
+	}
+
+	for _, job := range jobs {
+		if job.Status == models.StatusPending {
+			jh.worker.EnqueueJob(job.ID)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(jobs)
+}
+
+// GetJobGraph handles GET /jobs/graph?rootId=<id> - returns the root job and
+// every transitive descendant with its current status.
+func (jh *JobHandler) GetJobGraph(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	rootIDStr := r.URL.Query().Get("rootId")
+	if rootIDStr == "" {
+		http.Error(w, "rootId is required", http.StatusBadRequest)
+		return
+	}
+	rootID, err := primitive.ObjectIDFromHex(rootIDStr)
+	if err != nil {
+		http.Error(w, "Invalid rootId format", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var root models.Job
+	if err := jh.jobsCol.FindOne(ctx, bson.M{"_id": rootID}).Decode(&root); err != nil {
+		if err == mongo.ErrNoDocuments {
+			http.Error(w, "Job not found", http.StatusNotFound)
+		} else {
+			log.Printf("Failed to find root job: %v\n", err)
+			http.Error(w, "Failed to retrieve job graph", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	jobs := []models.Job{root}
+	visited := map[primitive.ObjectID]bool{root.ID: true}
+	queue := append([]primitive.ObjectID{}, root.ChildIDs...)
+
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		if visited[id] {
+			continue
+		}
+		visited[id] = true
+
+		var job models.Job
+		if err := jh.jobsCol.FindOne(ctx, bson.M{"_id": id}).Decode(&job); err != nil {
+			log.Printf("Failed to load descendant job %s: %v\n", id.Hex(), err)
+			continue
+		}
+		jobs = append(jobs, job)
+		queue = append(queue, job.ChildIDs...)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(jobs)
+}
@@ -13,6 +13,28 @@ type Job struct {
 	Payload    map[string]interface{}             `bson:"payload" json:"payload"`
 	RetryCount int                							  `bson:"retryCount" json:"retryCount"`
 	Status     string             								`bson:"status" json:"status"` // pending, processing, completed, failed
+	// Priority controls claim order across all eligible jobs: higher values
+	// are claimed first. Defaults to 0 so existing jobs are unaffected.
+	Priority   int                								`bson:"priority" json:"priority"`
+	// RunAt is nil for jobs that are ready to run as soon as a worker picks
+	// them up. Delayed jobs and retries waiting out a backoff set it to the
+	// earliest time a worker may claim them.
+	RunAt      *time.Time         								`bson:"runAt,omitempty" json:"runAt,omitempty"`
+	// LockedBy and LockedUntil implement the claim: a worker sets both when
+	// it picks the job up, refreshes LockedUntil with a heartbeat while it
+	// runs, and clears both when the job leaves the "processing" state. A
+	// reaper resets jobs whose lock expired back to pending.
+	LockedBy    string          								`bson:"lockedBy,omitempty" json:"lockedBy,omitempty"`
+	LockedUntil *time.Time      								`bson:"lockedUntil,omitempty" json:"lockedUntil,omitempty"`
+	// ParentIDs and ChildIDs wire up a job DAG created via POST /jobs/graph.
+	// A job with parents starts life as StatusBlocked and only becomes
+	// StatusPending once every parent reaches StatusCompleted.
+	ParentIDs []primitive.ObjectID `bson:"parentIds,omitempty" json:"parentIds,omitempty"`
+	ChildIDs  []primitive.ObjectID `bson:"childIds,omitempty" json:"childIds,omitempty"`
+	// CausedByFailureID is set when this job was cancelled because an
+	// ancestor in its DAG failed past MaxRetries, so callers can trace why
+	// a downstream job never ran.
+	CausedByFailureID *primitive.ObjectID `bson:"causedByFailureId,omitempty" json:"causedByFailureId,omitempty"`
 	CreatedAt  time.Time          								`bson:"createdAt" json:"createdAt"`
 	UpdatedAt  time.Time          								`bson:"updatedAt" json:"updatedAt"`
 }
@@ -20,8 +42,14 @@ type Job struct {
 // Valid statuses for a job
 const (
 	StatusPending    = "pending"
+	// StatusBlocked means the job is part of a DAG and is waiting on
+	// parents to complete before it becomes eligible for dispatch.
+	StatusBlocked    = "blocked"
 	StatusProcessing = "processing"
 	StatusCompleted  = "completed"
 	StatusFailed     = "failed"
-	MaxRetries = 3
+	// StatusCancelled means an ancestor in this job's DAG failed past
+	// MaxRetries, so this job was skipped rather than ever dispatched.
+	StatusCancelled = "cancelled"
+	MaxRetries      = 3
 )
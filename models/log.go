@@ -0,0 +1,26 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// JobLog is a single structured log line emitted by a handler while it runs.
+// Seq is monotonically increasing per job so callers can page through logs
+// with `after=<seq>` and follow new ones as they're written.
+type JobLog struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	JobID     primitive.ObjectID `bson:"jobID" json:"jobID"`
+	Seq       int64              `bson:"seq" json:"seq"`
+	Timestamp time.Time          `bson:"timestamp" json:"timestamp"`
+	Level     string             `bson:"level" json:"level"`
+	Message   string             `bson:"message" json:"message"`
+}
+
+// Log levels a JobLogger accepts.
+const (
+	LogLevelInfo  = "info"
+	LogLevelWarn  = "warn"
+	LogLevelError = "error"
+)
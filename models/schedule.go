@@ -0,0 +1,20 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ScheduledJob represents a recurring job spec created via POST
+// /jobs/schedule. On each firing the scheduler inserts a fresh Job document
+// with Type/Payload copied from the spec, then advances NextRun.
+type ScheduledJob struct {
+	ID        primitive.ObjectID     `bson:"_id,omitempty" json:"id"`
+	CronExpr  string                 `bson:"cronExpr" json:"cronExpr"`
+	Type      string                 `bson:"type" json:"type"`
+	Payload   map[string]interface{} `bson:"payload" json:"payload"`
+	NextRun   time.Time              `bson:"nextRun" json:"nextRun"`
+	CreatedAt time.Time              `bson:"createdAt" json:"createdAt"`
+	UpdatedAt time.Time              `bson:"updatedAt" json:"updatedAt"`
+}
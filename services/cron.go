@@ -0,0 +1,128 @@
+package services
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cronSchedule is a parsed standard 5-field cron expression
+// (minute hour day-of-month month day-of-week). Each field is either "*" or
+// a comma-separated list of integers; ranges and step values aren't
+// supported, which covers the recurring jobs this queue needs without
+// pulling in a full cron parser.
+type cronSchedule struct {
+	minutes  map[int]bool
+	hours    map[int]bool
+	days     map[int]bool
+	months   map[int]bool
+	weekdays map[int]bool
+	// dayIsRestricted/weekdayIsRestricted record whether the day-of-month
+	// or day-of-week field was anything other than "*". Standard cron ORs
+	// the two fields together when both are restricted, and otherwise
+	// just applies whichever one is restricted (a "*" field is not a
+	// constraint at all).
+	dayIsRestricted     bool
+	weekdayIsRestricted bool
+}
+
+func parseCronField(field string, min, max int) (map[int]bool, error) {
+	values := make(map[int]bool)
+	if field == "*" {
+		for i := min; i <= max; i++ {
+			values[i] = true
+		}
+		return values, nil
+	}
+
+	for _, part := range strings.Split(field, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil {
+			return nil, fmt.Errorf("invalid cron field %q: %w", field, err)
+		}
+		if n < min || n > max {
+			return nil, fmt.Errorf("cron field %q out of range [%d,%d]", field, min, max)
+		}
+		values[n] = true
+	}
+	return values, nil
+}
+
+// parseCronExpr parses a standard 5-field cron expression.
+func parseCronExpr(expr string) (*cronSchedule, error) {
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron expression must have 5 fields, got %d", len(fields))
+	}
+
+	minutes, err := parseCronField(fields[0], 0, 59)
+	if err != nil {
+		return nil, err
+	}
+	hours, err := parseCronField(fields[1], 0, 23)
+	if err != nil {
+		return nil, err
+	}
+	days, err := parseCronField(fields[2], 1, 31)
+	if err != nil {
+		return nil, err
+	}
+	months, err := parseCronField(fields[3], 1, 12)
+	if err != nil {
+		return nil, err
+	}
+	weekdays, err := parseCronField(fields[4], 0, 6)
+	if err != nil {
+		return nil, err
+	}
+
+	return &cronSchedule{
+		minutes:             minutes,
+		hours:               hours,
+		days:                days,
+		months:              months,
+		weekdays:            weekdays,
+		dayIsRestricted:     fields[2] != "*",
+		weekdayIsRestricted: fields[4] != "*",
+	}, nil
+}
+
+func (cs *cronSchedule) matches(t time.Time) bool {
+	if !cs.minutes[t.Minute()] || !cs.hours[t.Hour()] || !cs.months[int(t.Month())] {
+		return false
+	}
+
+	// Standard cron: when both day-of-month and day-of-week are
+	// restricted, a candidate matches if it satisfies either one (OR),
+	// not both. When only one (or neither) is restricted, the
+	// unrestricted field is "*" and imposes no constraint, so the
+	// restricted field alone decides.
+	if cs.dayIsRestricted && cs.weekdayIsRestricted {
+		return cs.days[t.Day()] || cs.weekdays[int(t.Weekday())]
+	}
+	return cs.days[t.Day()] && cs.weekdays[int(t.Weekday())]
+}
+
+// maxCronLookahead bounds how far into the future nextCronRun will search
+// before giving up, so a nonsensical expression (e.g. Feb 30th) fails fast
+// instead of looping forever.
+const maxCronLookahead = 366 * 24 * 60
+
+// NextCronRun returns the next time after `from` that satisfies the given
+// standard 5-field cron expression.
+func NextCronRun(expr string, from time.Time) (time.Time, error) {
+	schedule, err := parseCronExpr(expr)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	candidate := from.Truncate(time.Minute).Add(time.Minute)
+	for i := 0; i < maxCronLookahead; i++ {
+		if schedule.matches(candidate) {
+			return candidate, nil
+		}
+		candidate = candidate.Add(time.Minute)
+	}
+	return time.Time{}, fmt.Errorf("no matching run time for cron expression %q within lookahead window", expr)
+}
@@ -0,0 +1,72 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"jobqueue/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// JobLogger lets a handler record progress for the job it's running. It
+// implements io.Writer so handlers can plug it directly into anything that
+// takes a writer (e.g. an exec.Cmd's Stdout), with each write persisted as
+// one log line with a monotonically increasing sequence number.
+type JobLogger struct {
+	jobID   primitive.ObjectID
+	logsCol *mongo.Collection
+	seq     int64
+}
+
+// newJobLogger creates a logger for jobID, continuing the sequence from
+// however many log lines that job already has (a retried job keeps its
+// history instead of restarting the count at zero).
+func newJobLogger(jobID primitive.ObjectID, logsCol *mongo.Collection) *JobLogger {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	count, err := logsCol.CountDocuments(ctx, bson.M{"jobID": jobID})
+	if err != nil {
+		log.Printf("Failed to count existing logs for job %s: %v\n", jobID.Hex(), err)
+		count = 0
+	}
+
+	return &JobLogger{jobID: jobID, logsCol: logsCol, seq: count}
+}
+
+// Write implements io.Writer, logging p at LogLevelInfo.
+func (jl *JobLogger) Write(p []byte) (int, error) {
+	jl.log(models.LogLevelInfo, strings.TrimRight(string(p), "\n"))
+	return len(p), nil
+}
+
+// Logf records a formatted message at the given level.
+func (jl *JobLogger) Logf(level, format string, args ...interface{}) {
+	jl.log(level, fmt.Sprintf(format, args...))
+}
+
+func (jl *JobLogger) log(level, message string) {
+	seq := atomic.AddInt64(&jl.seq, 1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	entry := models.JobLog{
+		ID:        primitive.NewObjectID(),
+		JobID:     jl.jobID,
+		Seq:       seq,
+		Timestamp: time.Now(),
+		Level:     level,
+		Message:   message,
+	}
+	if _, err := jl.logsCol.InsertOne(ctx, entry); err != nil {
+		log.Printf("Failed to persist log line for job %s: %v\n", jl.jobID.Hex(), err)
+	}
+}
@@ -2,7 +2,11 @@ package services
 
 import (
 	"context"
+	"fmt"
 	"log"
+	"math/rand"
+	"os"
+	"sync"
 	"time"
 
 	"jobqueue/models"
@@ -10,139 +14,562 @@ import (
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-// JobWorker processes jobs from the queue
+// DefaultHandlerTimeout is used for registered types that don't set their own timeout.
+const DefaultHandlerTimeout = 30 * time.Second
+
+// BaseRetryBackoff and MaxRetryBackoff bound the exponential backoff applied
+// between retries: delay = min(BaseRetryBackoff*2^retryCount, MaxRetryBackoff),
+// jittered so retries of a burst of failed jobs don't all wake up at once.
+const (
+	BaseRetryBackoff = 1 * time.Second
+	MaxRetryBackoff  = 5 * time.Minute
+)
+
+// Claim-loop tuning. VisibilityTimeout is how long a claimed job may run
+// before another worker is allowed to consider it abandoned;
+// HeartbeatInterval must be comfortably shorter so a healthy worker renews
+// the lock well before it expires.
+const (
+	DefaultVisibilityTimeout = 30 * time.Second
+	DefaultHeartbeatInterval = 10 * time.Second
+	DefaultPollInterval      = 2 * time.Second
+	DefaultReaperInterval    = 15 * time.Second
+)
+
+// nextRetryDelay computes the backoff before the given retry attempt.
+func nextRetryDelay(retryCount int) time.Duration {
+	delay := BaseRetryBackoff * time.Duration(1<<uint(retryCount))
+	if delay <= 0 || delay > MaxRetryBackoff {
+		delay = MaxRetryBackoff
+	}
+	jitter := time.Duration(rand.Int63n(int64(delay)/2 + 1))
+	return delay/2 + jitter
+}
+
+// HandlerFunc is the function signature users implement to process a job of a
+// given type. It receives a context that is cancelled once the type's
+// configured timeout elapses, and a logger for recording progress that
+// operators can retrieve via GET /jobs/logs.
+type HandlerFunc func(ctx context.Context, payload map[string]interface{}, logger *JobLogger) error
+
+// HandlerConfig holds the per-type limits enforced while dispatching to a
+// registered handler.
+type HandlerConfig struct {
+	Timeout     time.Duration
+	MaxRetries  int
+	Concurrency int
+}
+
+// JobTypeInfo describes a registered handler for API responses.
+type JobTypeInfo struct {
+	Type        string  `json:"type"`
+	Timeout     float64 `json:"timeoutSeconds"`
+	MaxRetries  int     `json:"maxRetries"`
+	Concurrency int     `json:"concurrency"`
+}
+
+type handlerEntry struct {
+	fn     HandlerFunc
+	config HandlerConfig
+}
+
+// JobWorker claims and processes jobs directly from MongoDB. The queue is
+// authoritative in the jobs collection itself: a job is "in the queue" for
+// as long as it's status=pending, so nothing is lost if every process
+// restarts, and multiple server instances can run workers against the same
+// collection without double-processing a job.
 type JobWorker struct {
-	jobQueue   chan primitive.ObjectID
 	jobsCol    *mongo.Collection
+	logsCol    *mongo.Collection
 	stopChan   chan struct{}
 	numWorkers int
+	instanceID string
+
+	// wakeChan lets EnqueueJob nudge an idle worker into claiming
+	// immediately instead of waiting for the next poll tick.
+	wakeChan chan struct{}
+
+	visibilityTimeout time.Duration
+	heartbeatInterval time.Duration
+	pollInterval      time.Duration
+	reaperInterval    time.Duration
+
+	handlersMu sync.RWMutex
+	handlers   map[string]handlerEntry
+
+	// activeMu guards per-type in-flight counts used to enforce each type's
+	// Concurrency cap: a type at its cap is excluded from claims until one
+	// of its jobs finishes, leaving it pending for another worker/tick.
+	activeMu    sync.Mutex
+	activeCount map[string]int
 }
 
 // NewJobWorker creates a new job worker with the specified number of worker goroutines
-func NewJobWorker(jobsCollection *mongo.Collection, queueSize int, numWorkers int) *JobWorker {
+func NewJobWorker(jobsCollection, logsCollection *mongo.Collection, queueSize int, numWorkers int) *JobWorker {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "worker"
+	}
+
 	return &JobWorker{
-		jobQueue:   make(chan primitive.ObjectID, queueSize),
-		jobsCol:    jobsCollection,
-		stopChan:   make(chan struct{}),
-		numWorkers: numWorkers,
+		jobsCol:           jobsCollection,
+		logsCol:           logsCollection,
+		stopChan:          make(chan struct{}),
+		numWorkers:        numWorkers,
+		instanceID:        fmt.Sprintf("%s-%d", hostname, os.Getpid()),
+		wakeChan:          make(chan struct{}, queueSize),
+		visibilityTimeout: DefaultVisibilityTimeout,
+		heartbeatInterval: DefaultHeartbeatInterval,
+		pollInterval:      DefaultPollInterval,
+		reaperInterval:    DefaultReaperInterval,
+		handlers:          make(map[string]handlerEntry),
+		activeCount:       make(map[string]int),
+	}
+}
+
+// Register associates a job type with the function that processes it. config
+// is optional per-type tuning; zero values fall back to DefaultHandlerTimeout
+// and models.MaxRetries, with no concurrency limit.
+func (jw *JobWorker) Register(jobType string, fn HandlerFunc, config HandlerConfig) {
+	if config.Timeout <= 0 {
+		config.Timeout = DefaultHandlerTimeout
+	}
+	if config.MaxRetries <= 0 {
+		config.MaxRetries = models.MaxRetries
+	}
+
+	jw.handlersMu.Lock()
+	defer jw.handlersMu.Unlock()
+	jw.handlers[jobType] = handlerEntry{fn: fn, config: config}
+}
+
+// IsRegistered reports whether jobType has a registered handler.
+func (jw *JobWorker) IsRegistered(jobType string) bool {
+	jw.handlersMu.RLock()
+	defer jw.handlersMu.RUnlock()
+	_, ok := jw.handlers[jobType]
+	return ok
+}
+
+// JobTypes returns the configured limits for every registered handler, for
+// operators inspecting what the worker will accept.
+func (jw *JobWorker) JobTypes() []JobTypeInfo {
+	jw.handlersMu.RLock()
+	defer jw.handlersMu.RUnlock()
+
+	types := make([]JobTypeInfo, 0, len(jw.handlers))
+	for jobType, entry := range jw.handlers {
+		types = append(types, JobTypeInfo{
+			Type:        jobType,
+			Timeout:     entry.config.Timeout.Seconds(),
+			MaxRetries:  entry.config.MaxRetries,
+			Concurrency: entry.config.Concurrency,
+		})
 	}
+	return types
 }
 
-// Start initializes and starts worker goroutines to process jobs
-// Each worker reads job IDs from the job queue channel and processes them
+func (jw *JobWorker) lookupHandler(jobType string) (handlerEntry, bool) {
+	jw.handlersMu.RLock()
+	defer jw.handlersMu.RUnlock()
+	entry, ok := jw.handlers[jobType]
+	return entry, ok
+}
+
+// Start initializes and starts worker goroutines to process jobs, plus the
+// reaper goroutine that recovers jobs left behind by a crashed worker.
 func (jw *JobWorker) Start() {
-	log.Printf("Starting %d job worker(s)\n", jw.numWorkers)
+	log.Printf("Starting %d job worker(s) as %s\n", jw.numWorkers, jw.instanceID)
 
-	// Start multiple worker goroutines
 	for i := 1; i <= jw.numWorkers; i++ {
 		go jw.worker(i)
 	}
+	go jw.runReaper()
 }
 
-// worker is a single worker goroutine that processes jobs
-// It continuously reads job IDs from the jobQueue channel and updates their status
+// worker is a single worker goroutine. It wakes on a poll tick or an
+// EnqueueJob signal and claims jobs from MongoDB until none are left.
 func (jw *JobWorker) worker(id int) {
-	log.Printf("Worker %d started\n", id)
+	workerID := fmt.Sprintf("%s-%d", jw.instanceID, id)
+	log.Printf("Worker %s started\n", workerID)
+
+	ticker := time.NewTicker(jw.pollInterval)
+	defer ticker.Stop()
 
 	for {
 		select {
-		case jobID := <-jw.jobQueue:
-			// Process the job
-			jw.processJob(jobID)
-
 		case <-jw.stopChan:
-			log.Printf("Worker %d stopped\n", id)
+			log.Printf("Worker %s stopped\n", workerID)
 			return
+		case <-jw.wakeChan:
+		case <-ticker.C:
 		}
+
+		for {
+			job, err := jw.claimJob(workerID)
+			if err != nil {
+				log.Printf("Worker %s failed to claim a job: %v\n", workerID, err)
+				break
+			}
+			if job == nil {
+				break
+			}
+
+			jw.runClaimedJob(job, workerID)
+
+			select {
+			case <-jw.stopChan:
+				return
+			default:
+			}
+		}
+	}
+}
+
+// typesAtCapacity returns the registered types whose in-flight count has
+// reached their configured Concurrency limit, so claimJob can skip them and
+// leave their jobs pending for another worker/tick.
+func (jw *JobWorker) typesAtCapacity() []string {
+	jw.handlersMu.RLock()
+	limits := make(map[string]int, len(jw.handlers))
+	for jobType, entry := range jw.handlers {
+		if entry.config.Concurrency > 0 {
+			limits[jobType] = entry.config.Concurrency
+		}
+	}
+	jw.handlersMu.RUnlock()
+
+	if len(limits) == 0 {
+		return nil
+	}
+
+	jw.activeMu.Lock()
+	defer jw.activeMu.Unlock()
+
+	var atCap []string
+	for jobType, limit := range limits {
+		if jw.activeCount[jobType] >= limit {
+			atCap = append(atCap, jobType)
+		}
+	}
+	return atCap
+}
+
+func (jw *JobWorker) incrementActive(jobType string) {
+	jw.activeMu.Lock()
+	jw.activeCount[jobType]++
+	jw.activeMu.Unlock()
+}
+
+func (jw *JobWorker) decrementActive(jobType string) {
+	jw.activeMu.Lock()
+	if jw.activeCount[jobType] > 0 {
+		jw.activeCount[jobType]--
 	}
+	jw.activeMu.Unlock()
 }
 
-// processJob updates the job status through its lifecycle
-func (jw *JobWorker) processJob(jobID primitive.ObjectID) {
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+// claimJob atomically claims the highest-priority eligible pending job
+// (ties broken by age): not currently locked by another worker, not past
+// its type's concurrency cap, and either unscheduled or past its runAt. It
+// returns (nil, nil) when there's nothing to claim.
+func (jw *JobWorker) claimJob(workerID string) (*models.Job, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	// Fetch the job
+	now := time.Now()
+	filter := bson.M{
+		"status": models.StatusPending,
+		"$and": []bson.M{
+			{"$or": []bson.M{
+				{"lockedUntil": bson.M{"$exists": false}},
+				{"lockedUntil": bson.M{"$lt": now}},
+			}},
+			{"$or": []bson.M{
+				{"runAt": bson.M{"$exists": false}},
+				{"runAt": bson.M{"$lte": now}},
+			}},
+		},
+	}
+	if atCap := jw.typesAtCapacity(); len(atCap) > 0 {
+		filter["type"] = bson.M{"$nin": atCap}
+	}
+
+	update := bson.M{
+		"$set": bson.M{
+			"status":      models.StatusProcessing,
+			"lockedBy":    workerID,
+			"lockedUntil": now.Add(jw.visibilityTimeout),
+			"updatedAt":   now,
+		},
+	}
+	opts := options.FindOneAndUpdate().
+		SetSort(bson.D{{Key: "priority", Value: -1}, {Key: "createdAt", Value: 1}}).
+		SetReturnDocument(options.After)
+
 	var job models.Job
-	err := jw.jobsCol.FindOne(ctx, bson.M{"_id": jobID}).Decode(&job)
+	err := jw.jobsCol.FindOneAndUpdate(ctx, filter, update, opts).Decode(&job)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
 	if err != nil {
-		log.Printf("Failed to find job %s: %v\n", jobID.Hex(), err)
-		return
+		return nil, err
 	}
 
-	// Update status to processing
-	_, err = jw.jobsCol.UpdateOne(ctx, bson.M{"_id": jobID}, bson.M{
-		"$set": bson.M{"status": models.StatusProcessing, "updatedAt": time.Now()},
-	})
+	jw.incrementActive(job.Type)
+	return &job, nil
+}
+
+// runClaimedJob runs the handler for a claimed job while a heartbeat
+// goroutine extends its lock, then finalizes its status.
+func (jw *JobWorker) runClaimedJob(job *models.Job, workerID string) {
+	defer jw.decrementActive(job.Type)
+
+	stopHeartbeat := make(chan struct{})
+	go jw.heartbeat(job.ID, workerID, stopHeartbeat)
+	defer close(stopHeartbeat)
+
+	jw.processJob(job, workerID)
+}
+
+// heartbeat periodically extends lockedUntil for an in-flight job so the
+// reaper doesn't reclaim it out from under a worker that's still running it.
+func (jw *JobWorker) heartbeat(jobID primitive.ObjectID, workerID string, stop <-chan struct{}) {
+	ticker := time.NewTicker(jw.heartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			_, err := jw.jobsCol.UpdateOne(ctx,
+				bson.M{"_id": jobID, "lockedBy": workerID},
+				bson.M{"$set": bson.M{"lockedUntil": time.Now().Add(jw.visibilityTimeout)}},
+			)
+			cancel()
+			if err != nil {
+				log.Printf("Failed to extend lock for job %s: %v\n", jobID.Hex(), err)
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+// runReaper periodically resets jobs whose lock has expired back to pending
+// so they can be claimed again, recovering work left behind by a crashed
+// worker.
+func (jw *JobWorker) runReaper() {
+	ticker := time.NewTicker(jw.reaperInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			jw.reapExpiredLocks()
+		case <-jw.stopChan:
+			return
+		}
+	}
+}
+
+func (jw *JobWorker) reapExpiredLocks() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result, err := jw.jobsCol.UpdateMany(ctx,
+		bson.M{"status": models.StatusProcessing, "lockedUntil": bson.M{"$lt": time.Now()}},
+		bson.M{
+			"$set":   bson.M{"status": models.StatusPending, "updatedAt": time.Now()},
+			"$unset": bson.M{"lockedBy": "", "lockedUntil": ""},
+		},
+	)
 	if err != nil {
-		log.Printf("Failed to update job %s to processing: %v\n", jobID.Hex(), err)
+		log.Printf("Reaper failed to reset expired locks: %v\n", err)
+		return
+	}
+	if result.ModifiedCount > 0 {
+		log.Printf("Reaper reclaimed %d job(s) with an expired lock\n", result.ModifiedCount)
+		jw.EnqueueJob(primitive.NilObjectID)
+	}
+}
+
+// runHandler invokes fn with ctx, converting a recovered panic into an error
+// so a misbehaving handler can't take a worker goroutine down with it.
+func runHandler(ctx context.Context, fn HandlerFunc, payload map[string]interface{}, logger *JobLogger) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("handler panicked: %v", r)
+		}
+	}()
+	return fn(ctx, payload, logger)
+}
+
+// processJob runs the handler for an already-claimed job and finalizes its
+// status, clearing the claim lock in the same update.
+func (jw *JobWorker) processJob(job *models.Job, workerID string) {
+	jobID := job.ID
+
+	entry, ok := jw.lookupHandler(job.Type)
+	if !ok {
+		log.Printf("No handler registered for job %s type %q, marking failed\n", jobID.Hex(), job.Type)
+		jw.finalize(jobID, bson.M{"$set": bson.M{"status": models.StatusFailed, "updatedAt": time.Now()},
+			"$unset": bson.M{"lockedBy": "", "lockedUntil": ""}})
 		return
 	}
 
-	log.Printf("Processing job: %s\n", jobID.Hex())
+	log.Printf("Processing job: %s (type=%s, worker=%s)\n", jobID.Hex(), job.Type, workerID)
 
-	// Simulate execution: fail if payload has "fail": true
-	if val, ok := job.Payload["fail"].(bool); ok && val {
-		// Increment retry count
+	logger := newJobLogger(jobID, jw.logsCol)
+	handlerCtx, handlerCancel := context.WithTimeout(context.Background(), entry.config.Timeout)
+	handlerErr := runHandler(handlerCtx, entry.fn, job.Payload, logger)
+	handlerCancel()
+
+	if handlerErr != nil {
 		newRetryCount := job.RetryCount + 1
-		update := bson.M{
-			"status":     models.StatusFailed,
-			"retryCount": newRetryCount,
-			"updatedAt":  time.Now(),
-		}
-		_, err = jw.jobsCol.UpdateOne(ctx, bson.M{"_id": jobID}, bson.M{"$set": update})
-		if err != nil {
-			log.Printf("Failed to mark job %s as failed: %v\n", jobID.Hex(), err)
+
+		if newRetryCount < entry.config.MaxRetries {
+			// Schedule a delayed retry instead of re-enqueueing immediately,
+			// so a broken job backs off rather than spinning at full speed.
+			runAt := time.Now().Add(nextRetryDelay(newRetryCount))
+			jw.finalize(jobID, bson.M{
+				"$set": bson.M{
+					"status":     models.StatusPending,
+					"retryCount": newRetryCount,
+					"runAt":      runAt,
+					"updatedAt":  time.Now(),
+				},
+				"$unset": bson.M{"lockedBy": "", "lockedUntil": ""},
+			})
+
+			log.Printf("Job %s failed (retry count: %d): %v; retrying at %s\n",
+				jobID.Hex(), newRetryCount, handlerErr, runAt.Format(time.RFC3339))
+			return
 		}
 
-		log.Printf("Job %s failed (retry count: %d)\n", jobID.Hex(), newRetryCount)
+		jw.finalize(jobID, bson.M{
+			"$set": bson.M{
+				"status":     models.StatusFailed,
+				"retryCount": newRetryCount,
+				"updatedAt":  time.Now(),
+			},
+			"$unset": bson.M{"lockedBy": "", "lockedUntil": ""},
+		})
 
-		// Requeue if retries < MaxRetries
-		const MaxRetries = 3
-		if newRetryCount < MaxRetries {
-			log.Printf("Re-enqueueing job %s for retry\n", jobID.Hex())
-			jw.EnqueueJob(jobID)
+		log.Printf("Job %s failed permanently after %d attempts: %v\n", jobID.Hex(), newRetryCount, handlerErr)
+		if len(job.ChildIDs) > 0 {
+			jw.cancelDescendants(jobID, job.ChildIDs)
 		}
 		return
 	}
 
-	// Normal successful execution
-	time.Sleep(2 * time.Second)
-
-	_, err = jw.jobsCol.UpdateOne(ctx, bson.M{"_id": jobID}, bson.M{
-		"$set": bson.M{"status": models.StatusCompleted, "updatedAt": time.Now()},
+	jw.finalize(jobID, bson.M{
+		"$set":   bson.M{"status": models.StatusCompleted, "updatedAt": time.Now()},
+		"$unset": bson.M{"lockedBy": "", "lockedUntil": ""},
 	})
-	if err != nil {
-		log.Printf("Failed to update job %s to completed: %v\n", jobID.Hex(), err)
-		return
-	}
 
 	log.Printf("Completed job: %s\n", jobID.Hex())
+	if len(job.ChildIDs) > 0 {
+		jw.dispatchReadyChildren(job.ChildIDs)
+	}
+}
+
+// dispatchReadyChildren transitions each blocked child to pending once every
+// one of its parents has completed, and wakes a worker to claim it.
+func (jw *JobWorker) dispatchReadyChildren(childIDs []primitive.ObjectID) {
+	for _, childID := range childIDs {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		var child models.Job
+		err := jw.jobsCol.FindOne(ctx, bson.M{"_id": childID}).Decode(&child)
+		cancel()
+		if err != nil {
+			log.Printf("Failed to load child job %s: %v\n", childID.Hex(), err)
+			continue
+		}
+		if child.Status != models.StatusBlocked {
+			continue
+		}
+
+		ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+		incomplete, err := jw.jobsCol.CountDocuments(ctx, bson.M{
+			"_id":    bson.M{"$in": child.ParentIDs},
+			"status": bson.M{"$ne": models.StatusCompleted},
+		})
+		cancel()
+		if err != nil {
+			log.Printf("Failed to check parents of job %s: %v\n", childID.Hex(), err)
+			continue
+		}
+		if incomplete > 0 {
+			continue
+		}
+
+		jw.finalize(childID, bson.M{"$set": bson.M{"status": models.StatusPending, "updatedAt": time.Now()}})
+		log.Printf("Job %s unblocked, all parents completed\n", childID.Hex())
+		jw.EnqueueJob(childID)
+	}
 }
 
+// cancelDescendants walks the DAG below a permanently failed job and marks
+// every non-terminal descendant StatusCancelled, recording originID so
+// callers can trace why a downstream job never ran.
+func (jw *JobWorker) cancelDescendants(originID primitive.ObjectID, childIDs []primitive.ObjectID) {
+	visited := make(map[primitive.ObjectID]bool)
+	queue := append([]primitive.ObjectID{}, childIDs...)
 
-func (jw *JobWorker) updateStatus(jobID primitive.ObjectID, status string) {
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		if visited[id] {
+			continue
+		}
+		visited[id] = true
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		var child models.Job
+		err := jw.jobsCol.FindOne(ctx, bson.M{"_id": id}).Decode(&child)
+		cancel()
+		if err != nil {
+			log.Printf("Failed to load descendant job %s: %v\n", id.Hex(), err)
+			continue
+		}
+
+		if child.Status != models.StatusCompleted && child.Status != models.StatusCancelled {
+			jw.finalize(id, bson.M{"$set": bson.M{
+				"status":            models.StatusCancelled,
+				"causedByFailureId": originID,
+				"updatedAt":         time.Now(),
+			}})
+			log.Printf("Cancelled job %s: ancestor %s failed permanently\n", id.Hex(), originID.Hex())
+		}
+
+		queue = append(queue, child.ChildIDs...)
+	}
+}
+
+func (jw *JobWorker) finalize(jobID primitive.ObjectID, update bson.M) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	jw.jobsCol.UpdateOne(ctx,
-		bson.M{"_id": jobID},
-		bson.M{
-			"$set": bson.M{
-				"status":    status,
-				"updatedAt": time.Now(),
-			},
-		},
-	)
+	if _, err := jw.jobsCol.UpdateOne(ctx, bson.M{"_id": jobID}, update); err != nil {
+		log.Printf("Failed to finalize job %s: %v\n", jobID.Hex(), err)
+	}
 }
 
+// EnqueueJob wakes an idle worker to attempt an immediate claim. The queue
+// itself lives in MongoDB, so this is a hint, not a handoff: it's safe to
+// call with any job ID, including a zero one, purely to nudge workers.
 func (jw *JobWorker) EnqueueJob(jobID primitive.ObjectID) {
-	jw.jobQueue <- jobID
+	select {
+	case jw.wakeChan <- struct{}{}:
+	default:
+	}
 }
 
 func (jw *JobWorker) Stop() {
 	log.Println("Stopping all workers...")
 	close(jw.stopChan)
-}
\ No newline at end of file
+}
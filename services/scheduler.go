@@ -0,0 +1,139 @@
+package services
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"jobqueue/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Scheduler polls MongoDB for jobs whose delay has elapsed and for recurring
+// cron specs that are due to fire. Delayed jobs and retries already live in
+// the jobs collection with a future runAt, so the scheduler doesn't need to
+// hand them anywhere; it only nudges the worker pool to claim sooner than
+// the next poll tick, and materializes cron specs into new Job documents.
+type Scheduler struct {
+	jobsCol      *mongo.Collection
+	scheduledCol *mongo.Collection
+	worker       *JobWorker
+	pollInterval time.Duration
+	stopChan     chan struct{}
+}
+
+// NewScheduler creates a scheduler that polls at the given interval.
+func NewScheduler(jobsCol, scheduledCol *mongo.Collection, worker *JobWorker, pollInterval time.Duration) *Scheduler {
+	return &Scheduler{
+		jobsCol:      jobsCol,
+		scheduledCol: scheduledCol,
+		worker:       worker,
+		pollInterval: pollInterval,
+		stopChan:     make(chan struct{}),
+	}
+}
+
+// Start begins polling in the background.
+func (s *Scheduler) Start() {
+	log.Printf("Starting scheduler (poll interval %s)\n", s.pollInterval)
+	go s.run()
+}
+
+// Stop halts the polling goroutine.
+func (s *Scheduler) Stop() {
+	close(s.stopChan)
+}
+
+func (s *Scheduler) run() {
+	ticker := time.NewTicker(s.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.dispatchDueJobs()
+			s.fireDueCronJobs()
+
+		case <-s.stopChan:
+			log.Println("Scheduler stopped")
+			return
+		}
+	}
+}
+
+// dispatchDueJobs nudges the worker pool when one-shot delayed jobs or
+// backed-off retries have crossed their runAt. Workers claim jobs directly
+// from MongoDB (see JobWorker.claimJob), so this only shortens the wait
+// versus the worker's own poll ticker; it doesn't hand off the job itself.
+func (s *Scheduler) dispatchDueJobs() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	count, err := s.jobsCol.CountDocuments(ctx, bson.M{
+		"status": models.StatusPending,
+		"runAt":  bson.M{"$lte": time.Now()},
+	})
+	if err != nil {
+		log.Printf("Scheduler: failed to query due jobs: %v\n", err)
+		return
+	}
+	if count > 0 {
+		s.worker.EnqueueJob(primitive.NilObjectID)
+	}
+}
+
+// fireDueCronJobs inserts a fresh Job for every recurring spec whose
+// nextRun has elapsed, then advances that spec's nextRun.
+func (s *Scheduler) fireDueCronJobs() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	cursor, err := s.scheduledCol.Find(ctx, bson.M{"nextRun": bson.M{"$lte": time.Now()}})
+	if err != nil {
+		log.Printf("Scheduler: failed to query due cron specs: %v\n", err)
+		return
+	}
+	defer cursor.Close(ctx)
+
+	var specs []models.ScheduledJob
+	if err := cursor.All(ctx, &specs); err != nil {
+		log.Printf("Scheduler: failed to decode cron specs: %v\n", err)
+		return
+	}
+
+	for _, spec := range specs {
+		now := time.Now()
+		job := models.Job{
+			Type:      spec.Type,
+			Payload:   spec.Payload,
+			Status:    models.StatusPending,
+			CreatedAt: now,
+			UpdatedAt: now,
+		}
+
+		result, err := s.jobsCol.InsertOne(ctx, job)
+		if err != nil {
+			log.Printf("Scheduler: failed to insert job for cron spec %s: %v\n", spec.ID.Hex(), err)
+			continue
+		}
+
+		nextRun, err := NextCronRun(spec.CronExpr, now)
+		if err != nil {
+			log.Printf("Scheduler: failed to compute next run for cron spec %s: %v\n", spec.ID.Hex(), err)
+			continue
+		}
+
+		_, err = s.scheduledCol.UpdateOne(ctx, bson.M{"_id": spec.ID}, bson.M{
+			"$set": bson.M{"nextRun": nextRun, "updatedAt": now},
+		})
+		if err != nil {
+			log.Printf("Scheduler: failed to advance cron spec %s: %v\n", spec.ID.Hex(), err)
+		}
+
+		log.Printf("Scheduler: fired cron spec %s, next run at %s\n", spec.ID.Hex(), nextRun.Format(time.RFC3339))
+		s.worker.EnqueueJob(result.InsertedID.(primitive.ObjectID))
+	}
+}